@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"text/template"
+)
+
+// actionConfig describes what to do when a watched file changes. Type
+// selects the executor: "shell" (default, sh -c / cmd /C), "exec" (argv,
+// no shell), "http" (webhook POST) or "signal" (send a signal to a daemon
+// tracked by a PID file).
+type actionConfig struct {
+	Type string `json:"type"`
+
+	// shell
+	Command string `json:"command"`
+
+	// exec
+	Argv []string `json:"argv"`
+
+	// http
+	URL        string            `json:"url"`
+	Body       string            `json:"body"`
+	Headers    map[string]string `json:"headers"`
+	HMACSecret string            `json:"hmacSecret"`
+
+	// signal
+	Signal  string `json:"signal"`
+	PIDFile string `json:"pidFile"`
+
+	// shell, exec: Dir overrides the working directory (defaults to the
+	// repo path) and Env holds additional "KEY=VALUE" pairs appended to the
+	// child's environment. Both support template expansion.
+	Dir string   `json:"dir"`
+	Env []string `json:"env"`
+}
+
+// templateVars are the fields available to text/template expansion in
+// shell/exec arguments and http bodies.
+type templateVars struct {
+	Repo    string
+	RelPath string
+	Event   string
+	AbsPath string
+}
+
+// executor runs an action and returns any output worth logging.
+type executor interface {
+	run(vars templateVars) (string, error)
+}
+
+// buildExecutor resolves config.Action into a concrete executor, falling
+// back to a shell executor running the legacy Execute string when no Action
+// type is configured.
+func buildExecutor(cfg actionConfig) (executor, error) {
+	switch cfg.Type {
+	case "", "shell":
+		command := cfg.Command
+		if command == "" {
+			command = config.Execute
+		}
+		return &shellExecutor{command: command, dir: cfg.Dir, env: cfg.Env}, nil
+	case "exec":
+		return &execExecutor{argv: cfg.Argv, dir: cfg.Dir, env: cfg.Env}, nil
+	case "http":
+		return &httpExecutor{cfg: cfg}, nil
+	case "signal":
+		return &signalExecutor{cfg: cfg}, nil
+	default:
+		return nil, fmt.Errorf("unknown action type: %s", cfg.Type)
+	}
+}
+
+// expandTemplate runs text/template over tmplText with vars, returning the
+// original text unchanged if it contains no template actions.
+func expandTemplate(tmplText string, vars templateVars) (string, error) {
+	tmpl, err := template.New("action").Parse(tmplText)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// shellExecutor runs command through the platform shell: sh -c on Unix,
+// cmd /C on Windows.
+type shellExecutor struct {
+	command string
+	dir     string
+	env     []string
+}
+
+func (e *shellExecutor) run(vars templateVars) (string, error) {
+	command, err := expandTemplate(e.command, vars)
+	if err != nil {
+		return "", err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	if err := applyDirAndEnv(cmd, e.dir, e.env, vars); err != nil {
+		return "", err
+	}
+
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+// execExecutor runs argv directly, without an intervening shell.
+type execExecutor struct {
+	argv []string
+	dir  string
+	env  []string
+}
+
+func (e *execExecutor) run(vars templateVars) (string, error) {
+	if len(e.argv) == 0 {
+		return "", fmt.Errorf("exec action requires a non-empty argv")
+	}
+
+	argv := make([]string, len(e.argv))
+	for i, arg := range e.argv {
+		expanded, err := expandTemplate(arg, vars)
+		if err != nil {
+			return "", err
+		}
+		argv[i] = expanded
+	}
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	if err := applyDirAndEnv(cmd, e.dir, e.env, vars); err != nil {
+		return "", err
+	}
+
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+// applyDirAndEnv sets cmd.Dir (defaulting to vars.Repo) and, if env entries
+// are given, appends them to the inherited environment. Both dir and each
+// env entry are template-expanded first.
+func applyDirAndEnv(cmd *exec.Cmd, dir string, env []string, vars templateVars) error {
+	cmd.Dir = vars.Repo
+	if dir != "" {
+		expanded, err := expandTemplate(dir, vars)
+		if err != nil {
+			return err
+		}
+		cmd.Dir = expanded
+	}
+
+	if len(env) == 0 {
+		return nil
+	}
+
+	cmd.Env = append([]string{}, os.Environ()...)
+	for _, entry := range env {
+		expanded, err := expandTemplate(entry, vars)
+		if err != nil {
+			return err
+		}
+		cmd.Env = append(cmd.Env, expanded)
+	}
+
+	return nil
+}
+
+// httpExecutor POSTs a JSON body describing the change to a webhook URL,
+// optionally signing it with HMAC-SHA256 so the receiver can verify origin.
+type httpExecutor struct {
+	cfg actionConfig
+}
+
+func (e *httpExecutor) run(vars templateVars) (string, error) {
+	body, err := e.buildBody(vars)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	for key, value := range e.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	if e.cfg.HMACSecret != "" {
+		mac := hmac.New(sha256.New, []byte(e.cfg.HMACSecret))
+		mac.Write(body)
+		req.Header.Set("X-RepoWatch-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("webhook %s returned status %s", e.cfg.URL, resp.Status)
+	}
+
+	return fmt.Sprintf("webhook %s returned status %s", e.cfg.URL, resp.Status), nil
+}
+
+func (e *httpExecutor) buildBody(vars templateVars) ([]byte, error) {
+	if e.cfg.Body != "" {
+		expanded, err := expandTemplate(e.cfg.Body, vars)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(expanded), nil
+	}
+
+	return json.Marshal(struct {
+		Repo  string `json:"repo"`
+		Path  string `json:"path"`
+		Event string `json:"event"`
+		Op    string `json:"op"`
+	}{
+		Repo:  vars.Repo,
+		Path:  vars.RelPath,
+		Event: vars.Event,
+		Op:    vars.Event,
+	})
+}
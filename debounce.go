@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDebounceMs is used when config.DebounceMs is left unset.
+const defaultDebounceMs = 500
+
+// debouncer coalesces bursts of fsnotify events for the same repo into a
+// single run. Editors commonly emit Create+Chmod+Write for one logical save,
+// and some save strategies rename a temp file over the original, so a naive
+// "run on every event" approach fires the configured command several times
+// for what the user considers one change.
+type debouncer struct {
+	mu           sync.Mutex
+	timers       map[string]*time.Timer
+	fileModTimes map[string]time.Time
+}
+
+func newDebouncer() *debouncer {
+	return &debouncer{
+		timers:       map[string]*time.Timer{},
+		fileModTimes: map[string]time.Time{},
+	}
+}
+
+// seenModTime reports whether path was already seen with this exact ModTime,
+// recording it if not. A true result means the event can be safely dropped
+// because the file content hasn't actually changed since the last run.
+func (d *debouncer) seenModTime(path string, modTime time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if last, ok := d.fileModTimes[path]; ok && last.Equal(modTime) {
+		return true
+	}
+
+	d.fileModTimes[path] = modTime
+	return false
+}
+
+// schedule resets the quiet-window timer for repoPath so that run only fires
+// once no further events have arrived for that repo within delay.
+func (d *debouncer) schedule(repoPath string, delay time.Duration, run func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if timer, ok := d.timers[repoPath]; ok {
+		timer.Stop()
+	}
+
+	d.timers[repoPath] = time.AfterFunc(delay, run)
+}
+
+// forget stops any pending timer for repoPath and drops its cached file
+// ModTimes. Without this, a long-running daemon watching a churny
+// ReposRoot leaks an entry per repo ever seen, and a timer already
+// in flight when the repo is removed would still fire runAction against a
+// path that no longer exists.
+func (d *debouncer) forget(repoPath string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if timer, ok := d.timers[repoPath]; ok {
+		timer.Stop()
+		delete(d.timers, repoPath)
+	}
+
+	prefix := repoPath + string(os.PathSeparator)
+	for path := range d.fileModTimes {
+		if strings.HasPrefix(path, prefix) {
+			delete(d.fileModTimes, path)
+		}
+	}
+}
+
+// debounceDelayFor returns the debounce window for repoPath: the repo's
+// DebounceMs override if it has one, else config.DebounceMs, else
+// defaultDebounceMs.
+func debounceDelayFor(repoPath string) time.Duration {
+	reposMutex.Lock()
+	spec := repoSpecs[repoPath]
+	reposMutex.Unlock()
+
+	ms := config.DebounceMs
+	if spec != nil && spec.DebounceMs > 0 {
+		ms = spec.DebounceMs
+	}
+	if ms <= 0 {
+		ms = defaultDebounceMs
+	}
+
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDebouncerSeenModTime(t *testing.T) {
+	d := newDebouncer()
+	t1 := time.Unix(1000, 0)
+	t2 := time.Unix(2000, 0)
+
+	if d.seenModTime("/repo/file.go", t1) {
+		t.Fatalf("seenModTime reported a duplicate on first sighting")
+	}
+	if !d.seenModTime("/repo/file.go", t1) {
+		t.Fatalf("seenModTime didn't report a duplicate for the same ModTime")
+	}
+	if d.seenModTime("/repo/file.go", t2) {
+		t.Fatalf("seenModTime reported a duplicate for a changed ModTime")
+	}
+}
+
+func TestDebouncerScheduleCoalesces(t *testing.T) {
+	d := newDebouncer()
+	runs := 0
+	done := make(chan struct{})
+
+	for i := 0; i < 3; i++ {
+		d.schedule("/repo", 10*time.Millisecond, func() {
+			runs++
+			close(done)
+		})
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("scheduled run never fired")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if runs != 1 {
+		t.Fatalf("got %d runs, want 1 (repeated schedule calls should coalesce into the last timer)", runs)
+	}
+}
+
+func TestDebouncerForget(t *testing.T) {
+	d := newDebouncer()
+	ran := false
+
+	d.seenModTime("/repo/a/file.go", time.Unix(1, 0))
+	d.seenModTime("/repo-other/file.go", time.Unix(1, 0))
+	d.schedule("/repo", 10*time.Millisecond, func() { ran = true })
+
+	d.forget("/repo")
+
+	time.Sleep(50 * time.Millisecond)
+	if ran {
+		t.Fatalf("forget didn't stop the pending timer")
+	}
+
+	if _, ok := d.fileModTimes["/repo/a/file.go"]; ok {
+		t.Fatalf("forget left a ModTime entry under the forgotten repo")
+	}
+	if _, ok := d.fileModTimes["/repo-other/file.go"]; !ok {
+		t.Fatalf("forget deleted a ModTime entry belonging to a different repo")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reconcileInterval is how often the on-disk repo list is diffed against
+// currentlyWatching to recover from any Create/Remove events the repos
+// watcher missed.
+const reconcileInterval = 60 * time.Second
+
+// drainWatcherErrors logs every error fsnotify reports on a watcher. Without
+// this, a watcher that hits inotify's watch limit or ENOSPC fails silently
+// and the daemon keeps running with a stale, partially-broken watch set.
+func drainWatcherErrors(errs <-chan error) {
+	for err := range errs {
+		if err == nil {
+			continue
+		}
+
+		appLogger.Error("", "", err.Error())
+
+		if isWatchExhaustedError(err) {
+			recoverWatches()
+		}
+	}
+}
+
+// isWatchExhaustedError reports whether err indicates the watcher dropped
+// watches because it ran out of capacity: fsnotify's own overflow error, or
+// the OS-level inotify watch-limit/ENOSPC errors it wraps.
+func isWatchExhaustedError(err error) bool {
+	if err == fsnotify.ErrEventOverflow {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "no space left on device") ||
+		strings.Contains(msg, "too many open files")
+}
+
+// recoverWatches rebuilds the entire watch set from scratch by re-running
+// addRepo for every repo the daemon believes it's watching. This is the
+// self-healing step after a watcher drops watches under overflow/ENOSPC.
+func recoverWatches() {
+	appLogger.Warn("", "", "Rebuilding watch set after watcher error")
+
+	reposMutex.Lock()
+	repos := make([]string, 0, len(currentlyWatching))
+	for repo := range currentlyWatching {
+		repos = append(repos, repo)
+	}
+	reposMutex.Unlock()
+
+	for _, repo := range repos {
+		removeRepo(repo)
+		addRepo(repo)
+	}
+}
+
+// reconcileRepos diffs the on-disk repo list against currentlyWatching,
+// adding any repos that appeared without a Create event reaching us and
+// removing any that disappeared without a Remove/Rename event reaching us.
+func reconcileRepos(reposRoot string) {
+	files, err := ioutil.ReadDir(reposRoot)
+	if err != nil {
+		appLogger.Error("", "", err.Error())
+		return
+	}
+
+	onDisk := map[string]bool{}
+	for _, file := range files {
+		repoPath := filepath.Clean(reposRoot + "/" + file.Name())
+		onDisk[repoPath] = true
+		addRepo(repoPath)
+	}
+
+	reposMutex.Lock()
+	stale := []string{}
+	for repo := range currentlyWatching {
+		if !onDisk[repo] {
+			stale = append(stale, repo)
+		}
+	}
+	reposMutex.Unlock()
+
+	for _, repo := range stale {
+		removeRepo(repo)
+	}
+}
+
+// shutdown closes both watchers and flushes the logger so no log entry is
+// lost when the process receives SIGINT/SIGTERM.
+func shutdown() {
+	reposWatcher.Close()
+	watcher.Close()
+	appLogger.Close()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLogFile is used when config.LogFile is unset. It is a relative
+// path, so it resolves against the process's working directory.
+const defaultLogFile = "repo-watcher.log"
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+func parseLogLevel(s string) logLevel {
+	switch strings.ToLower(s) {
+	case "debug":
+		return levelDebug
+	case "warn", "warning":
+		return levelWarn
+	case "error":
+		return levelError
+	default:
+		return levelInfo
+	}
+}
+
+func (l logLevel) String() string {
+	switch l {
+	case levelDebug:
+		return "debug"
+	case levelWarn:
+		return "warn"
+	case levelError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+// Logger is the logging interface used throughout repo-watcher. repo and
+// event are optional context (empty string when not applicable, e.g. during
+// startup) and are carried as their own fields in JSON output rather than
+// interpolated into msg.
+type Logger interface {
+	Debug(repo, event, msg string)
+	Info(repo, event, msg string)
+	Warn(repo, event, msg string)
+	Error(repo, event, msg string)
+	Close() error
+}
+
+// fileLogger writes level-filtered entries to stdout and to a size-rotated
+// file. Writes are mutex-guarded because events are processed by two
+// concurrent watcher goroutines (repos watcher and file watcher), and the
+// previous implementation's open/append/close-per-call had no such guard.
+type fileLogger struct {
+	mu           sync.Mutex
+	file         *os.File
+	path         string
+	jsonOutput   bool
+	minLevel     logLevel
+	maxSizeBytes int64
+	maxBackups   int
+	size         int64
+}
+
+func newFileLogger(path string, minLevel logLevel, jsonOutput bool, maxSizeMB, maxBackups int) (*fileLogger, error) {
+	l := &fileLogger{
+		path:         path,
+		jsonOutput:   jsonOutput,
+		minLevel:     minLevel,
+		maxSizeBytes: int64(maxSizeMB) * 1024 * 1024,
+		maxBackups:   maxBackups,
+	}
+
+	if err := l.openFile(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *fileLogger) openFile() error {
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if info, err := f.Stat(); err == nil {
+		l.size = info.Size()
+	}
+
+	l.file = f
+	return nil
+}
+
+func (l *fileLogger) Debug(repo, event, msg string) { l.write(levelDebug, repo, event, msg) }
+func (l *fileLogger) Info(repo, event, msg string)  { l.write(levelInfo, repo, event, msg) }
+func (l *fileLogger) Warn(repo, event, msg string)  { l.write(levelWarn, repo, event, msg) }
+func (l *fileLogger) Error(repo, event, msg string) { l.write(levelError, repo, event, msg) }
+
+func (l *fileLogger) write(level logLevel, repo, event, msg string) {
+	if level < l.minLevel {
+		return
+	}
+
+	line := l.format(level, repo, event, msg)
+	fmt.Println(line)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxSizeBytes > 0 && l.size+int64(len(line))+1 > l.maxSizeBytes {
+		l.rotate()
+	}
+
+	n, err := l.file.WriteString(line + "\n")
+	if err == nil {
+		l.size += int64(n)
+	}
+}
+
+func (l *fileLogger) format(level logLevel, repo, event, msg string) string {
+	ts := time.Now().Format(time.RFC3339)
+
+	if l.jsonOutput {
+		data, _ := json.Marshal(struct {
+			Timestamp string `json:"ts"`
+			Level     string `json:"level"`
+			Repo      string `json:"repo,omitempty"`
+			Event     string `json:"event,omitempty"`
+			Message   string `json:"msg"`
+		}{ts, level.String(), repo, event, msg})
+
+		return string(data)
+	}
+
+	line := fmt.Sprintf("%s [%s]", ts, level.String())
+	if repo != "" {
+		line += " repo=" + repo
+	}
+	if event != "" {
+		line += " event=" + event
+	}
+
+	return line + " " + msg
+}
+
+// rotate closes the current file, bubbles existing numbered backups up by
+// one (dropping anything beyond maxBackups) and opens a fresh file in their
+// place. Callers must hold l.mu. When maxBackups is 0 (the default when
+// LogMaxBackups is unset), the current file is just truncated in place instead of
+// keeping a backup, since there's nowhere configured to keep it.
+func (l *fileLogger) rotate() {
+	l.file.Close()
+
+	if l.maxBackups <= 0 {
+		l.file, _ = os.OpenFile(l.path, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
+		l.size = 0
+		return
+	}
+
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxBackups+1))
+	os.Rename(l.path, fmt.Sprintf("%s.1", l.path))
+
+	l.openFile()
+	l.size = 0
+}
+
+func (l *fileLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
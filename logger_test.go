@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileLoggerRotateNoBackupsWhenUnset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "repo-watcher.log")
+
+	l, err := newFileLogger(path, levelInfo, false, 1, 0)
+	if err != nil {
+		t.Fatalf("newFileLogger: %v", err)
+	}
+	defer l.Close()
+
+	l.file.WriteString("stale content")
+	l.size = 100
+
+	l.rotate()
+
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Fatalf("rotate created a backup file despite maxBackups=0: %v", err)
+	}
+	if l.size != 0 {
+		t.Fatalf("rotate left size at %d, want 0", l.size)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading rotated log: %v", err)
+	}
+	if len(data) != 0 {
+		t.Fatalf("rotated log not truncated, got %q", data)
+	}
+}
+
+func TestFileLoggerRotateKeepsBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "repo-watcher.log")
+
+	l, err := newFileLogger(path, levelInfo, false, 1, 2)
+	if err != nil {
+		t.Fatalf("newFileLogger: %v", err)
+	}
+	defer l.Close()
+
+	l.file.WriteString("first")
+	l.size = 100
+	l.rotate()
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("rotate didn't create %s.1: %v", path, err)
+	}
+
+	l.file.WriteString("second")
+	l.size = 100
+	l.rotate()
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("rotate didn't keep %s.1 after a second rotation: %v", path, err)
+	}
+	if _, err := os.Stat(path + ".2"); err != nil {
+		t.Fatalf("rotate didn't bubble the previous %s.1 up to .2: %v", path, err)
+	}
+}
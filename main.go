@@ -5,31 +5,36 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
 type watcherConfig struct {
-	ReposRoot   string `json:"reposRoot"`
-	WatchPath   string `json:"watchPath"`
-	WatchRegexp string `json:"watchRegexp"`
-	Execute     string `json:"execute"`
+	ReposRoot     string       `json:"reposRoot"`
+	WatchPath     string       `json:"watchPath"`
+	WatchPaths    []string     `json:"watchPaths"`
+	ExcludeDirs   []string     `json:"excludeDirs"`
+	Recursive     bool         `json:"recursive"`
+	WatchRegexp   string       `json:"watchRegexp"`
+	Execute       string       `json:"execute"`
+	DebounceMs    int          `json:"debounceMs"`
+	Action        actionConfig `json:"action"`
+	LogFile       string       `json:"logFile"`
+	LogLevel      string       `json:"logLevel"`
+	LogJSON       bool         `json:"logJSON"`
+	LogMaxSizeMB  int          `json:"logMaxSizeMB"`
+	LogMaxBackups int          `json:"logMaxBackups"`
 }
 
 var config watcherConfig
 
-type logType string
-
-const (
-	logInfo  logType = "info"
-	logError logType = "error"
-)
-
 var (
 	reposMutex    *sync.Mutex
 	reposWatcher  *fsnotify.Watcher
@@ -39,10 +44,28 @@ var (
 
 var currentlyWatching map[string]bool
 
-func main() {
-	log(logInfo, "Starting repos watcher...")
+// watchedDirs maps a repo path to the set of absolute subdirectories of that
+// repo currently registered with the fsnotify watcher. It lets removeRepo
+// tear down an entire subtree instead of the single WatchPath directory.
+var watchedDirs map[string]map[string]bool
+
+// repoSpecs maps a repo path to its per-repo override loaded from a
+// .repowatch.yml/.repowatch.json in the repo root, or nil if it has none.
+var repoSpecs map[string]*repoSpec
 
+var execDebouncer *debouncer
+var action executor
+var appLogger Logger
+
+func main() {
 	var err error
+	appLogger, err = newFileLogger(defaultLogFile, levelInfo, false, 0, 0)
+	if err != nil {
+		panic(err)
+	}
+
+	appLogger.Info("", "", "Starting repos watcher...")
+
 	reposWatcher, err = fsnotify.NewWatcher()
 	checkError(err)
 	defer reposWatcher.Close()
@@ -53,6 +76,9 @@ func main() {
 
 	reposMutex = &sync.Mutex{}
 	currentlyWatching = map[string]bool{}
+	watchedDirs = map[string]map[string]bool{}
+	repoSpecs = map[string]*repoSpec{}
+	execDebouncer = newDebouncer()
 
 	configData, err := ioutil.ReadFile("config.json")
 	checkError(err)
@@ -60,15 +86,30 @@ func main() {
 	err = json.Unmarshal(configData, &config)
 	checkError(err)
 
+	logFile := config.LogFile
+	if logFile == "" {
+		logFile = defaultLogFile
+	}
+
+	if logger, err := newFileLogger(logFile, parseLogLevel(config.LogLevel), config.LogJSON, config.LogMaxSizeMB, config.LogMaxBackups); err == nil {
+		appLogger.Close()
+		appLogger = logger
+	} else {
+		checkError(err)
+	}
+
 	watcherRegexp, err = regexp.Compile(config.WatchRegexp)
 	checkError(err)
 
+	action, err = buildExecutor(config.Action)
+	checkError(err)
+
 	watchRepos(config.ReposRoot)
 }
 
 func checkError(e error) {
 	if e != nil {
-		log(logError, e.Error())
+		appLogger.Error("", "", e.Error())
 	}
 }
 
@@ -82,39 +123,48 @@ func watchRepos(reposRoot string) {
 		panic("specified repos root is not a directory: " + reposRoot)
 	}
 
-	reposDone := make(chan bool)
 	go func() {
-		for {
-			select {
-			case event := <-reposWatcher.Events:
-				processReposEvent(event)
-			}
+		for event := range reposWatcher.Events {
+			processReposEvent(event)
 		}
 	}()
+	go drainWatcherErrors(reposWatcher.Errors)
 
 	err = reposWatcher.Add(reposRoot)
 	if err != nil {
-		log(logError, err.Error())
+		appLogger.Error("", "", err.Error())
 		return
 	}
 
-	done := make(chan bool)
 	go func() {
-		for {
-			select {
-			case event := <-watcher.Events:
-				processEvent(event)
-			}
+		for event := range watcher.Events {
+			processEvent(event)
 		}
 	}()
+	go drainWatcherErrors(watcher.Errors)
 
 	files, err := ioutil.ReadDir(reposRoot)
+	checkError(err)
 	for _, file := range files {
 		addRepo(reposRoot + "/" + file.Name())
 	}
 
-	<-done
-	<-reposDone
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sigCh:
+			appLogger.Info("", "", "Shutting down...")
+			shutdown()
+			return
+		case <-ticker.C:
+			reconcileRepos(reposRoot)
+		}
+	}
 }
 
 func processReposEvent(event fsnotify.Event) {
@@ -130,34 +180,169 @@ func processReposEvent(event fsnotify.Event) {
 }
 
 func processEvent(event fsnotify.Event) {
-	separator := string(os.PathSeparator)
-	if info, err := os.Stat(event.Name); os.IsNotExist(err) || info.IsDir() {
+	info, err := os.Stat(event.Name)
+	if os.IsNotExist(err) {
+		return
+	}
+
+	if err == nil && info.IsDir() {
+		if event.Op&fsnotify.Create == fsnotify.Create {
+			watchNewSubdir(event.Name)
+		}
 		return
 	}
 
 	dir, baseName := filepath.Split(event.Name)
-	if !watcherRegexp.Match([]byte(baseName)) {
+	repoPath := repoPathFromDir(dir)
+
+	reposMutex.Lock()
+	spec := repoSpecs[repoPath]
+	reposMutex.Unlock()
+
+	if isRepoSpecFile(baseName) {
+		if event.Op&(fsnotify.Write|fsnotify.Chmod) != 0 {
+			reloadRepoSpec(repoPath)
+		}
 		return
 	}
 
+	re, runner := watcherRegexp, action
+	if spec != nil {
+		re, runner = spec.regexp, spec.executor
+	}
+
+	if !re.Match([]byte(baseName)) {
+		return
+	}
+
+	if execDebouncer.seenModTime(event.Name, info.ModTime()) {
+		return
+	}
+
+	relPath, err := filepath.Rel(repoPath, event.Name)
+	if err != nil {
+		relPath = baseName
+	}
+
+	vars := templateVars{
+		Repo:    repoPath,
+		RelPath: relPath,
+		Event:   event.Op.String(),
+		AbsPath: event.Name,
+	}
+
+	execDebouncer.schedule(repoPath, debounceDelayFor(repoPath), func() {
+		runAction(runner, vars)
+	})
+}
+
+// reloadRepoSpec re-reads a repo's override file after it changes, so a
+// `.repowatch.yml` edit takes effect without restarting the daemon.
+func reloadRepoSpec(repoPath string) {
+	reposMutex.Lock()
+	repoSpecs[repoPath] = loadRepoSpec(repoPath)
+	reposMutex.Unlock()
+
+	appLogger.Info(repoPath, "", "Reloaded repo spec")
+}
+
+// runAction runs the resolved executor for the given change. It's called at
+// most once per debounce window no matter how many events fired during it.
+func runAction(runner executor, vars templateVars) {
+	appLogger.Info(vars.Repo, vars.Event, fmt.Sprintf("Running action for %q", vars.RelPath))
+
+	output, err := runner.run(vars)
+	if err != nil {
+		appLogger.Error(vars.Repo, vars.Event, err.Error())
+		return
+	}
+
+	appLogger.Info(vars.Repo, vars.Event, output)
+}
+
+// repoPathFromDir truncates dir down to the repo directory directly beneath
+// config.ReposRoot, e.g. "/repos/foo/src/pkg/" -> "/repos/foo".
+func repoPathFromDir(dir string) string {
+	separator := string(os.PathSeparator)
+
 	reposRootParts := filterEmptyParts(strings.Split(config.ReposRoot, separator))
 	dirPathParts := filterEmptyParts(strings.Split(dir, separator))
 
 	repoPath := strings.Join(dirPathParts[:len(reposRootParts)+1], separator)
+	if filepath.IsAbs(dir) {
+		repoPath = separator + repoPath
+	}
 
-	execMessage := fmt.Sprintf("[RepoWatch] Executing \"%s\" in \"%s\"", config.Execute, repoPath)
-	log(logInfo, execMessage)
+	return repoPath
+}
 
-	cmd := exec.Command("sh", "-c", config.Execute)
-	cmd.Dir = repoPath
+// watchNewSubdir registers a freshly created directory with the watcher if it
+// belongs to a repo that is already being watched recursively and isn't
+// excluded. fsnotify does not recurse on its own, so this is what lets newly
+// created nested directories (e.g. `mkdir -p` of a new package) get picked up
+// without restarting the process.
+func watchNewSubdir(path string) {
+	if !config.Recursive {
+		return
+	}
 
-	output, err := cmd.Output()
-	if err != nil {
-		log(logError, err.Error())
+	cleanPath := filepath.Clean(path)
+	if info, err := os.Stat(cleanPath); err != nil || !info.IsDir() {
+		return
+	}
+
+	dir, _ := filepath.Split(cleanPath)
+	repoPath := repoPathFromDir(dir + string(os.PathSeparator))
+
+	reposMutex.Lock()
+	defer reposMutex.Unlock()
+
+	if _, ok := currentlyWatching[repoPath]; !ok {
+		return
+	}
+
+	relPath, err := filepath.Rel(repoPath, cleanPath)
+	if err != nil || isExcludedDir(relPath) {
+		return
+	}
+
+	if relPath != "." && !underWatchPath(relPath, effectiveWatchPaths(repoSpecs[repoPath])) {
 		return
 	}
 
-	log(logInfo, string(output))
+	if err := watcher.Add(cleanPath); err != nil {
+		appLogger.Error(repoPath, "", err.Error())
+		return
+	}
+
+	if watchedDirs[repoPath] == nil {
+		watchedDirs[repoPath] = map[string]bool{}
+	}
+	watchedDirs[repoPath][cleanPath] = true
+
+	appLogger.Info(repoPath, "", "Watching new subdir: "+cleanPath)
+}
+
+// isExcludedDir reports whether relPath (relative to a repo root) matches any
+// of config.ExcludeDirs or is a hidden directory (dotfile convention).
+func isExcludedDir(relPath string) bool {
+	for _, part := range filterEmptyParts(strings.Split(relPath, string(os.PathSeparator))) {
+		if part != "." && strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+
+	for _, pattern := range config.ExcludeDirs {
+		if matched, _ := filepath.Match(pattern, relPath); matched {
+			return true
+		}
+
+		if matched, _ := filepath.Match(pattern, filepath.Base(relPath)); matched {
+			return true
+		}
+	}
+
+	return false
 }
 
 func filterEmptyParts(elements []string) []string {
@@ -172,47 +357,132 @@ func filterEmptyParts(elements []string) []string {
 	return result
 }
 
+// watchPaths returns the repo-relative paths that should be watched, falling
+// back to the legacy singular WatchPath when WatchPaths isn't set.
+func watchPaths() []string {
+	if len(config.WatchPaths) > 0 {
+		return config.WatchPaths
+	}
+
+	return []string{config.WatchPath}
+}
+
+// effectiveWatchPaths resolves the repo-relative paths to watch, preferring
+// a repo's own WatchPaths/WatchPath override (so a repo with a different
+// source layout can still be picked up) over the global config.
+func effectiveWatchPaths(spec *repoSpec) []string {
+	if spec != nil {
+		if len(spec.WatchPaths) > 0 {
+			return spec.WatchPaths
+		}
+		if spec.WatchPath != "" {
+			return []string{spec.WatchPath}
+		}
+	}
+
+	return watchPaths()
+}
+
+// underWatchPath reports whether relPath (relative to a repo root) falls
+// under one of watchPaths, i.e. is one of them or nested inside one.
+func underWatchPath(relPath string, watchPaths []string) bool {
+	for _, watchPath := range watchPaths {
+		cleanWatchPath := filepath.Clean(watchPath)
+		if cleanWatchPath == "." || relPath == cleanWatchPath {
+			return true
+		}
+		if strings.HasPrefix(relPath, cleanWatchPath+string(os.PathSeparator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func addRepo(path string) {
 	cleanPath := filepath.Clean(path)
 	if info, err := os.Stat(cleanPath); err != nil || !info.IsDir() {
 		return
 	}
 
-	targetPath := filepath.Clean(cleanPath + "/" + config.WatchPath)
-	if info, err := os.Stat(targetPath); err != nil || !info.IsDir() {
+	reposMutex.Lock()
+	_, alreadyWatching := currentlyWatching[cleanPath]
+	reposMutex.Unlock()
+	if alreadyWatching {
+		return
+	}
+
+	// Loaded before resolving watch paths so a repo whose override changes
+	// WatchPath/WatchPaths to a different layout is still discovered.
+	spec := loadRepoSpec(cleanPath)
+
+	dirs := map[string]bool{}
+	for _, watchPath := range effectiveWatchPaths(spec) {
+		targetPath := filepath.Clean(cleanPath + "/" + watchPath)
+		if info, err := os.Stat(targetPath); err != nil || !info.IsDir() {
+			continue
+		}
+
+		if !config.Recursive {
+			dirs[targetPath] = true
+			continue
+		}
+
+		filepath.Walk(targetPath, func(subPath string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			}
+
+			relPath, relErr := filepath.Rel(cleanPath, subPath)
+			if relErr == nil && isExcludedDir(relPath) {
+				return filepath.SkipDir
+			}
+
+			dirs[filepath.Clean(subPath)] = true
+			return nil
+		})
+	}
+
+	if len(dirs) == 0 {
 		return
 	}
 
+	// Always watch the repo root itself too, so a .repowatch.yml override
+	// placed there is picked up even if it falls outside every WatchPath.
+	dirs[cleanPath] = true
+
 	reposMutex.Lock()
 	if _, ok := currentlyWatching[cleanPath]; !ok {
-		log(logInfo, "[RepoWatch] Adding repo: "+cleanPath)
+		appLogger.Info(cleanPath, "", "Adding repo")
 
-		watcher.Add(targetPath)
+		watchedDirs[cleanPath] = map[string]bool{}
+		for dir := range dirs {
+			if err := watcher.Add(dir); err != nil {
+				appLogger.Error(cleanPath, "", err.Error())
+				continue
+			}
+			watchedDirs[cleanPath][dir] = true
+		}
 		currentlyWatching[cleanPath] = true
+		repoSpecs[cleanPath] = spec
 	}
 	reposMutex.Unlock()
 }
 
 func removeRepo(path string) {
 	cleanPath := filepath.Clean(path)
-	targetPath := filepath.Clean(cleanPath + "/" + config.WatchPath)
 
 	reposMutex.Lock()
 	if _, ok := currentlyWatching[cleanPath]; ok {
-		log(logInfo, "[RepoWatch] Removing repo: "+cleanPath)
+		appLogger.Info(cleanPath, "", "Removing repo")
 
-		watcher.Remove(targetPath)
+		for dir := range watchedDirs[cleanPath] {
+			watcher.Remove(dir)
+		}
+		delete(watchedDirs, cleanPath)
 		delete(currentlyWatching, cleanPath)
+		delete(repoSpecs, cleanPath)
+		execDebouncer.forget(cleanPath)
 	}
 	reposMutex.Unlock()
 }
-
-func log(kind logType, message string) {
-	fmt.Printf("%s: %s\n", kind, message)
-
-	logFilename := fmt.Sprintf("%s.log", kind)
-
-	f, _ := os.OpenFile(logFilename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	f.Write([]byte(message + "\n"))
-	f.Close()
-}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestRepoPathFromDirAbsolute(t *testing.T) {
+	orig := config.ReposRoot
+	defer func() { config.ReposRoot = orig }()
+
+	config.ReposRoot = "/tmp/repos"
+
+	got := repoPathFromDir("/tmp/repos/foo/src/")
+	want := "/tmp/repos/foo"
+	if got != want {
+		t.Fatalf("repoPathFromDir(%q) = %q, want %q", "/tmp/repos/foo/src/", got, want)
+	}
+}
+
+func TestRepoPathFromDirRelative(t *testing.T) {
+	orig := config.ReposRoot
+	defer func() { config.ReposRoot = orig }()
+
+	config.ReposRoot = "repos"
+
+	got := repoPathFromDir("repos/foo/src/")
+	want := "repos/foo"
+	if got != want {
+		t.Fatalf("repoPathFromDir(%q) = %q, want %q", "repos/foo/src/", got, want)
+	}
+}
+
+func TestUnderWatchPath(t *testing.T) {
+	cases := []struct {
+		relPath    string
+		watchPaths []string
+		want       bool
+	}{
+		{"src", []string{"src"}, true},
+		{"src/pkg", []string{"src"}, true},
+		{"vendor", []string{"src"}, false},
+		{"anything", []string{"."}, true},
+		{"vendor", []string{"src", "vendor"}, true},
+	}
+
+	for _, c := range cases {
+		if got := underWatchPath(c.relPath, c.watchPaths); got != c.want {
+			t.Errorf("underWatchPath(%q, %v) = %v, want %v", c.relPath, c.watchPaths, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// repoSpecFiles lists the override file names looked up in each repo root,
+// in priority order.
+var repoSpecFiles = []string{".repowatch.json", ".repowatch.yml", ".repowatch.yaml"}
+
+// repoSpec is a per-repo override of the global watcherConfig, loaded from a
+// `.repowatch.yml`/`.repowatch.json` file in the repo root. Any field left
+// at its zero value falls back to the global config.
+type repoSpec struct {
+	WatchPath   string       `json:"watchPath"`
+	WatchPaths  []string     `json:"watchPaths"`
+	WatchRegexp string       `json:"watchRegexp"`
+	Execute     string       `json:"execute"`
+	Action      actionConfig `json:"action"`
+	DebounceMs  int          `json:"debounceMs"`
+	Env         []string     `json:"env"`
+	Dir         string       `json:"dir"`
+
+	regexp   *regexp.Regexp
+	executor executor
+}
+
+// isRepoSpecFile reports whether baseName is one of the recognized per-repo
+// override file names.
+func isRepoSpecFile(baseName string) bool {
+	for _, name := range repoSpecFiles {
+		if baseName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadRepoSpec looks for a repoSpecFiles entry in repoPath and, if found,
+// parses and compiles it. It returns nil (not an error) when the repo has no
+// override file, which is the common case.
+func loadRepoSpec(repoPath string) *repoSpec {
+	for _, name := range repoSpecFiles {
+		data, err := ioutil.ReadFile(filepath.Join(repoPath, name))
+		if err != nil {
+			continue
+		}
+
+		jsonData := data
+		if !strings.HasSuffix(name, ".json") {
+			jsonData, err = yamlToJSON(data)
+			if err != nil {
+				appLogger.Error(repoPath, "", "parsing "+name+": "+err.Error())
+				return nil
+			}
+		}
+
+		spec := &repoSpec{}
+		if err := json.Unmarshal(jsonData, spec); err != nil {
+			appLogger.Error(repoPath, "", "parsing "+name+": "+err.Error())
+			return nil
+		}
+
+		if err := spec.compile(); err != nil {
+			appLogger.Error(repoPath, "", "compiling "+name+": "+err.Error())
+			return nil
+		}
+
+		return spec
+	}
+
+	return nil
+}
+
+// compile resolves the spec's regexp and executor, falling back to the
+// global ones for any field the repo didn't override.
+func (s *repoSpec) compile() error {
+	if s.WatchRegexp == "" {
+		s.regexp = watcherRegexp
+	} else {
+		re, err := regexp.Compile(s.WatchRegexp)
+		if err != nil {
+			return err
+		}
+		s.regexp = re
+	}
+
+	switch {
+	case s.Action.Type != "":
+		cfg := s.Action
+		if cfg.Dir == "" {
+			cfg.Dir = s.Dir
+		}
+		if len(cfg.Env) == 0 {
+			cfg.Env = s.Env
+		}
+		ex, err := buildExecutor(cfg)
+		if err != nil {
+			return err
+		}
+		s.executor = ex
+	case s.Execute != "":
+		ex, err := buildExecutor(actionConfig{Type: "shell", Command: s.Execute, Dir: s.Dir, Env: s.Env})
+		if err != nil {
+			return err
+		}
+		s.executor = ex
+	default:
+		if s.Dir == "" && len(s.Env) == 0 {
+			s.executor = action
+			break
+		}
+		cfg := config.Action
+		if s.Dir != "" {
+			cfg.Dir = s.Dir
+		}
+		if len(s.Env) > 0 {
+			cfg.Env = s.Env
+		}
+		ex, err := buildExecutor(cfg)
+		if err != nil {
+			return err
+		}
+		s.executor = ex
+	}
+
+	return nil
+}
+
+// yamlLine is one non-blank, non-comment source line with its indentation
+// depth (in leading whitespace characters) already measured.
+type yamlLine struct {
+	indent int
+	text   string
+}
+
+// yamlToJSON converts a restricted YAML subset (arbitrarily nested maps and
+// lists, via indentation) into JSON so it can be unmarshalled with the
+// standard encoding/json decoder. This project has no YAML dependency, so
+// it only needs to support the shapes repoSpec actually uses rather than
+// the full YAML spec. Indentation that doesn't resolve to a well-formed
+// nested block is reported as an error rather than silently misparsed.
+func yamlToJSON(data []byte) ([]byte, error) {
+	lines := tokenizeYAML(data)
+	if len(lines) == 0 {
+		return []byte("{}"), nil
+	}
+
+	root, pos, err := parseYAMLMap(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if pos != len(lines) {
+		return nil, fmt.Errorf("unexpected indentation at %q", lines[pos].text)
+	}
+
+	return json.Marshal(root)
+}
+
+func tokenizeYAML(data []byte) []yamlLine {
+	var lines []yamlLine
+
+	for _, raw := range strings.Split(string(data), "\n") {
+		line := strings.TrimRight(raw, "\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		lines = append(lines, yamlLine{indent: len(line) - len(trimmed), text: trimmed})
+	}
+
+	return lines
+}
+
+func isYAMLListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseYAMLMap consumes consecutive "key: value" lines at exactly indent,
+// recursing into a nested parseYAMLBlock whenever a key's value is empty
+// (i.e. the value lives on more-indented lines below it).
+func parseYAMLMap(lines []yamlLine, pos, indent int) (map[string]interface{}, int, error) {
+	result := map[string]interface{}{}
+
+	for pos < len(lines) && lines[pos].indent == indent && !isYAMLListItem(lines[pos].text) {
+		key, value, ok := splitYAMLPair(lines[pos].text)
+		if !ok {
+			return nil, pos, fmt.Errorf("invalid yaml line: %q", lines[pos].text)
+		}
+		pos++
+
+		if value != "" {
+			result[key] = parseYAMLScalar(value)
+			continue
+		}
+
+		if pos < len(lines) && lines[pos].indent > indent {
+			val, next, err := parseYAMLBlock(lines, pos)
+			if err != nil {
+				return nil, pos, err
+			}
+			result[key] = val
+			pos = next
+			continue
+		}
+
+		result[key] = nil
+	}
+
+	return result, pos, nil
+}
+
+// parseYAMLList consumes consecutive "- ..." lines at exactly indent.
+func parseYAMLList(lines []yamlLine, pos, indent int) ([]interface{}, int, error) {
+	var result []interface{}
+
+	for pos < len(lines) && lines[pos].indent == indent && isYAMLListItem(lines[pos].text) {
+		rest := strings.TrimSpace(strings.TrimPrefix(lines[pos].text, "-"))
+		pos++
+
+		if rest == "" {
+			if pos < len(lines) && lines[pos].indent > indent {
+				val, next, err := parseYAMLBlock(lines, pos)
+				if err != nil {
+					return nil, pos, err
+				}
+				result = append(result, val)
+				pos = next
+				continue
+			}
+
+			result = append(result, nil)
+			continue
+		}
+
+		if key, value, ok := splitYAMLPair(rest); ok {
+			// "- key: value" / "- key:" starts a map item inline with the
+			// dash; further keys of the same item line up two columns in.
+			itemIndent := indent + 2
+			item := map[string]interface{}{}
+			if value != "" {
+				item[key] = parseYAMLScalar(value)
+			} else if pos < len(lines) && lines[pos].indent > itemIndent {
+				val, next, err := parseYAMLBlock(lines, pos)
+				if err != nil {
+					return nil, pos, err
+				}
+				item[key] = val
+				pos = next
+			}
+
+			// Further keys of the same map item, aligned under the first key.
+			for pos < len(lines) && lines[pos].indent == itemIndent && !isYAMLListItem(lines[pos].text) {
+				k2, v2, next, err := parseYAMLMapEntry(lines, pos, itemIndent)
+				if err != nil {
+					return nil, pos, err
+				}
+				item[k2] = v2
+				pos = next
+			}
+
+			result = append(result, item)
+			continue
+		}
+
+		result = append(result, parseYAMLScalar(rest))
+	}
+
+	return result, pos, nil
+}
+
+// parseYAMLMapEntry parses a single "key: value" line at indent, recursing
+// if its value is on following more-indented lines.
+func parseYAMLMapEntry(lines []yamlLine, pos, indent int) (string, interface{}, int, error) {
+	key, value, ok := splitYAMLPair(lines[pos].text)
+	if !ok {
+		return "", nil, pos, fmt.Errorf("invalid yaml line: %q", lines[pos].text)
+	}
+	pos++
+
+	if value != "" {
+		return key, parseYAMLScalar(value), pos, nil
+	}
+
+	if pos < len(lines) && lines[pos].indent > indent {
+		val, next, err := parseYAMLBlock(lines, pos)
+		return key, val, next, err
+	}
+
+	return key, nil, pos, nil
+}
+
+// parseYAMLBlock parses the map or list starting at pos, at whatever
+// indentation that line itself is at.
+func parseYAMLBlock(lines []yamlLine, pos int) (interface{}, int, error) {
+	indent := lines[pos].indent
+
+	if isYAMLListItem(lines[pos].text) {
+		return parseYAMLList(lines, pos, indent)
+	}
+
+	return parseYAMLMap(lines, pos, indent)
+}
+
+func splitYAMLPair(line string) (key, value string, ok bool) {
+	parts := strings.SplitN(line, ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), true
+}
+
+// parseYAMLScalar converts a single YAML scalar into a Go value that
+// json.Marshal encodes as the equivalent JSON literal.
+func parseYAMLScalar(value string) interface{} {
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		return unquoted
+	}
+
+	if len(value) >= 2 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+
+	if strings.HasPrefix(value, "{") || strings.HasPrefix(value, "[") {
+		var raw interface{}
+		if err := json.Unmarshal([]byte(value), &raw); err == nil {
+			return raw
+		}
+	}
+
+	if i, err := strconv.Atoi(value); err == nil {
+		return i
+	}
+
+	if b, err := strconv.ParseBool(value); err == nil {
+		return b
+	}
+
+	return value
+}
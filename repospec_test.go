@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestYamlToJSONNested(t *testing.T) {
+	input := []byte("action:\n  type: exec\n  argv:\n    - echo\n    - hi\n")
+
+	data, err := yamlToJSON(input)
+	if err != nil {
+		t.Fatalf("yamlToJSON returned error: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("result is not valid JSON: %v (data: %s)", err, data)
+	}
+
+	want := map[string]interface{}{
+		"action": map[string]interface{}{
+			"type": "exec",
+			"argv": []interface{}{"echo", "hi"},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("yamlToJSON(%s) = %s, want %v", input, data, want)
+	}
+}
+
+func TestYamlToJSONFlat(t *testing.T) {
+	input := []byte("watchPath: src\ndebounceMs: 250\n")
+
+	data, err := yamlToJSON(input)
+	if err != nil {
+		t.Fatalf("yamlToJSON returned error: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("result is not valid JSON: %v (data: %s)", err, data)
+	}
+
+	want := map[string]interface{}{
+		"watchPath":  "src",
+		"debounceMs": float64(250),
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("yamlToJSON(%s) = %s, want %v", input, data, want)
+	}
+}
+
+func TestYamlToJSONSingleQuotedScalar(t *testing.T) {
+	input := []byte("watchRegexp: '\\.go$'\n")
+
+	data, err := yamlToJSON(input)
+	if err != nil {
+		t.Fatalf("yamlToJSON returned error: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("result is not valid JSON: %v (data: %s)", err, data)
+	}
+
+	want := map[string]interface{}{"watchRegexp": `\.go$`}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("yamlToJSON(%s) = %s, want %v", input, data, want)
+	}
+}
+
+func TestYamlToJSONInvalidIndentation(t *testing.T) {
+	input := []byte("a:\n  b: 1\n c: 2\n")
+
+	if _, err := yamlToJSON(input); err == nil {
+		t.Fatalf("yamlToJSON(%s) returned nil error for malformed indentation", input)
+	}
+}
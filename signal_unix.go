@@ -0,0 +1,64 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// signalExecutor sends a signal to the process whose PID is recorded in
+// PIDFile, for reloading long-running daemons instead of running a script.
+type signalExecutor struct {
+	cfg actionConfig
+}
+
+func (e *signalExecutor) run(vars templateVars) (string, error) {
+	sig, err := parseSignal(e.cfg.Signal)
+	if err != nil {
+		return "", err
+	}
+
+	pidFile, err := expandTemplate(e.cfg.PIDFile, vars)
+	if err != nil {
+		return "", err
+	}
+
+	pidData, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return "", fmt.Errorf("reading pid file %s: %w", pidFile, err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidData)))
+	if err != nil {
+		return "", fmt.Errorf("invalid pid in %s: %w", pidFile, err)
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return "", err
+	}
+
+	if err := process.Signal(sig); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sent %s to pid %d", e.cfg.Signal, pid), nil
+}
+
+func parseSignal(name string) (syscall.Signal, error) {
+	switch strings.ToUpper(name) {
+	case "SIGHUP", "HUP":
+		return syscall.SIGHUP, nil
+	case "SIGUSR1", "USR1":
+		return syscall.SIGUSR1, nil
+	case "SIGUSR2", "USR2":
+		return syscall.SIGUSR2, nil
+	default:
+		return 0, fmt.Errorf("unsupported signal: %s", name)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package main
+
+import "fmt"
+
+// signalExecutor is unsupported on Windows, which has no POSIX signal
+// equivalent for SIGHUP/SIGUSR1.
+type signalExecutor struct {
+	cfg actionConfig
+}
+
+func (e *signalExecutor) run(vars templateVars) (string, error) {
+	return "", fmt.Errorf("signal actions are not supported on windows")
+}